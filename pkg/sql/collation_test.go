@@ -0,0 +1,64 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// TestResolveUsingCollation covers the coercibility rules used to pick
+// a USING column's comparator collation: explicit beats implicit,
+// matching explicit collations are fine, conflicting explicit
+// collations are rejected, and an explicit collation can't be matched
+// against a non-string type on the other side.
+func TestResolveUsingCollation(t *testing.T) {
+	collated := func(locale string) parser.Type { return parser.TCollatedString{Locale: locale} }
+
+	testCases := []struct {
+		name        string
+		left, right parser.Type
+		wantLocale  string
+		wantOK      bool
+		wantErr     bool
+	}{
+		{"neither collated", parser.TypeString, parser.TypeString, "", false, false},
+		{"left explicit", collated("en"), parser.TypeString, "en", true, false},
+		{"right explicit", parser.TypeString, collated("en"), "en", true, false},
+		{"both explicit, same", collated("en"), collated("en"), "en", true, false},
+		{"both explicit, conflicting", collated("en"), collated("de"), "", false, true},
+		{"left explicit, right not a string", collated("en"), parser.TypeInt, "", false, true},
+		{"right explicit, left not a string", parser.TypeInt, collated("en"), "", false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			locale, ok, err := resolveUsingCollation(tc.left, tc.right)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tc.wantOK || locale != tc.wantLocale {
+				t.Errorf("resolveUsingCollation(%v, %v) = (%q, %v), want (%q, %v)",
+					tc.left, tc.right, locale, ok, tc.wantLocale, tc.wantOK)
+			}
+		})
+	}
+}
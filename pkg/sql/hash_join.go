@@ -0,0 +1,350 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
+)
+
+// maxHashJoinMemUsage bounds the size of the in-memory hash table built
+// by a hashJoinNode. There is no disk-spill implementation yet; once
+// the budget is exhausted the join errors out instead of silently
+// consuming unbounded memory. Spilling the hash table to a temporary
+// store is tracked as a follow-up, ideally against the same memory
+// monitor infrastructure the rest of the executor accounts against.
+const maxHashJoinMemUsage = 128 << 20 // 128MiB
+
+// minHashJoinRowCount is the row count estimate below which, on both
+// sides, a nested-loop join is preferred over a hash join: the
+// fixed cost of building and probing a hash table isn't worth paying
+// when a nested loop would do only a handful of comparisons anyway.
+const minHashJoinRowCount = 25
+
+// shouldUseHashJoin decides between the hash join and nested-loop
+// strategies using the row count estimates of the two inputs, mirroring
+// the simple cardinality-based heuristic used elsewhere in the planner
+// for index selection. When neither input can produce an estimate, hash
+// join is preferred: a wrong guess there degrades to one unnecessary
+// hash table build, whereas a wrong guess toward nested-loop degrades
+// quadratically.
+func shouldUseHashJoin(left, right planNode) bool {
+	leftCount, leftOK := estimateRows(left)
+	rightCount, rightOK := estimateRows(right)
+	return hashJoinPreferred(leftCount, leftOK, rightCount, rightOK)
+}
+
+// hashJoinPreferred implements the cardinality rule on its own, apart
+// from planNode, so it can be exercised directly in tests.
+func hashJoinPreferred(leftCount int64, leftOK bool, rightCount int64, rightOK bool) bool {
+	if !leftOK && !rightOK {
+		return true
+	}
+	if leftOK && leftCount < minHashJoinRowCount && rightOK && rightCount < minHashJoinRowCount {
+		return false
+	}
+	return true
+}
+
+// hashJoinNode evaluates a join by building an in-memory hash table
+// over the smaller input (keyed by joinPredicate.encode) and probing it
+// with rows from the other input, rather than comparing every pair of
+// rows as the nested-loop joinNode / the plain eval()-driven path does. It
+// only applies to predicates whose equality columns can be extracted:
+// equalityPredicate always qualifies; onPredicate qualifies whenever
+// its filter decomposes into at least one equijoin conjunct (see
+// onPredicate.equalityConjuncts), with any remaining conjuncts applied
+// as a residual filter via eval() on each candidate match.
+type hashJoinNode struct {
+	p *planner
+
+	left  planNode
+	right planNode
+	pred  joinPredicate
+	info  *dataSourceInfo
+
+	// buildSide/probeSide are leftSide or rightSide, indicating which
+	// input was chosen to build the hash table. This is decided once,
+	// in expandPlan(), using the row count estimates of the two inputs.
+	buildSide int
+	probeSide int
+
+	buildPlan planNode
+	probePlan planNode
+
+	table      map[string][]parser.DTuple
+	scratch    []byte
+	memUsage   int64
+	tableBuilt bool
+
+	// probeMatches holds the matches for the row currently being
+	// probed, plus a cursor into it; Next() walks probeMatches one row
+	// at a time before pulling another row from probePlan.
+	probeMatches []parser.DTuple
+	probeCursor  int
+	probeRow     parser.DTuple
+
+	row parser.DTuple
+}
+
+// makeHashJoinNode builds a hashJoinNode for left JOIN right ON/USING
+// pred, or returns ok=false if pred's equality columns cannot be
+// extracted (e.g. an ON clause with no equijoin conjunct at all), in
+// which case the caller should fall back to a nested-loop evaluation.
+func (p *planner) makeHashJoinNode(
+	left, right planNode, pred joinPredicate, info *dataSourceInfo,
+) (node *hashJoinNode, ok bool) {
+	switch pr := pred.(type) {
+	case *equalityPredicate:
+		if len(pr.leftColNames) == 0 {
+			// Nothing to hash on (e.g. NATURAL JOIN degenerating to a
+			// cross product never reaches here since it returns a
+			// crossPredicate instead).
+			return nil, false
+		}
+		if pr.joinType != joinInner {
+			// hashJoinNode has no matched-row bookkeeping for unmatched
+			// rows (see joinNode.rightMatched/emittingUnmatchedRight);
+			// fall back to the nested-loop join, which does.
+			return nil, false
+		}
+	case *onPredicate:
+		conjuncts, err := pr.equalityConjuncts()
+		if err != nil || len(conjuncts) == 0 {
+			return nil, false
+		}
+		if pr.joinType != joinInner {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if !shouldUseHashJoin(left, right) {
+		return nil, false
+	}
+
+	return &hashJoinNode{
+		p:     p,
+		left:  left,
+		right: right,
+		pred:  pred,
+		info:  info,
+	}, true
+}
+
+// estimatedRowCounter is implemented by planNodes that can cheaply
+// report an estimated row count (e.g. a scanNode consulting table
+// statistics). hashJoinNode uses it to pick the smaller input as the
+// build side when both inputs report an estimate; when either input
+// does not, the right input is the build side.
+type estimatedRowCounter interface {
+	estimatedRowCount() (count int64, ok bool)
+}
+
+func estimateRows(n planNode) (int64, bool) {
+	if e, ok := n.(estimatedRowCounter); ok {
+		return e.estimatedRowCount()
+	}
+	return 0, false
+}
+
+func (n *hashJoinNode) expandPlan() error {
+	if err := n.left.expandPlan(); err != nil {
+		return err
+	}
+	if err := n.right.expandPlan(); err != nil {
+		return err
+	}
+	if err := n.pred.expand(); err != nil {
+		return err
+	}
+
+	// Pick the smaller input as the build side when we have estimates
+	// for both; otherwise default to building on the right, which is
+	// the conventional choice since the left input commonly drives
+	// ordering that callers would like to preserve on the probe side.
+	n.buildSide, n.probeSide = rightSide, leftSide
+	leftCount, leftOK := estimateRows(n.left)
+	rightCount, rightOK := estimateRows(n.right)
+	if leftOK && rightOK && leftCount < rightCount {
+		n.buildSide, n.probeSide = leftSide, rightSide
+	}
+	if n.buildSide == leftSide {
+		n.buildPlan, n.probePlan = n.left, n.right
+	} else {
+		n.buildPlan, n.probePlan = n.right, n.left
+	}
+	return nil
+}
+
+func (n *hashJoinNode) Start() error {
+	if err := n.left.Start(); err != nil {
+		return err
+	}
+	if err := n.right.Start(); err != nil {
+		return err
+	}
+	return n.pred.start()
+}
+
+// rowByteSize approximates the heap footprint of row by summing each
+// column's actual encoded size, rather than assuming a fixed width per
+// Datum (a Datum is an interface, so its in-memory size depends
+// entirely on the concrete type it holds - a fixed-width guess is wrong
+// for every variable-length type, e.g. strings and decimals).
+func rowByteSize(row parser.DTuple) (int64, error) {
+	var buf []byte
+	var total int64
+	for _, d := range row {
+		var err error
+		buf, err = sqlbase.EncodeDatum(buf[:0], d)
+		if err != nil {
+			return 0, err
+		}
+		total += int64(len(buf))
+	}
+	return total, nil
+}
+
+// buildTable consumes buildPlan entirely into an in-memory hash table,
+// keyed by the encoding of its equality columns. Rows whose key
+// contains a NULL are never inserted: NULL never matches, not even
+// another NULL (SQL equality semantics), so a probe containing NULL
+// could never find them anyway.
+func (n *hashJoinNode) buildTable() error {
+	n.table = make(map[string][]parser.DTuple)
+	for {
+		next, err := n.buildPlan.Next()
+		if err != nil {
+			return err
+		}
+		if !next {
+			break
+		}
+		row := n.buildPlan.Values()
+
+		key, containsNull, err := n.pred.encode(n.scratch[:0], row, n.buildSide)
+		if err != nil {
+			return err
+		}
+		n.scratch = key[:0]
+		if containsNull {
+			continue
+		}
+
+		rowCopy := append(parser.DTuple(nil), row...)
+		rowSize, err := rowByteSize(rowCopy)
+		if err != nil {
+			return err
+		}
+		n.memUsage += int64(len(key)) + rowSize
+		if n.memUsage > maxHashJoinMemUsage {
+			return fmt.Errorf("hash join exceeded memory limit of %d bytes; spill-to-disk is not yet implemented", maxHashJoinMemUsage)
+		}
+
+		k := string(key)
+		n.table[k] = append(n.table[k], rowCopy)
+	}
+	n.tableBuilt = true
+	return nil
+}
+
+func (n *hashJoinNode) Next() (bool, error) {
+	if !n.tableBuilt {
+		if err := n.buildTable(); err != nil {
+			return false, err
+		}
+	}
+
+	if n.row == nil {
+		n.row = make(parser.DTuple, len(n.Columns()))
+	}
+
+	for {
+		// Exhaust the matches found for the current probe row first.
+		for n.probeCursor < len(n.probeMatches) {
+			buildRow := n.probeMatches[n.probeCursor]
+			n.probeCursor++
+
+			var leftRow, rightRow parser.DTuple
+			if n.probeSide == leftSide {
+				leftRow, rightRow = n.probeRow, buildRow
+			} else {
+				leftRow, rightRow = buildRow, n.probeRow
+			}
+
+			// The hash equality columns have already matched; eval()
+			// still runs to check any residual (non-equijoin)
+			// conjuncts left over from an ON clause.
+			ok, err := n.pred.eval(n.row, leftRow, rightRow)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				continue
+			}
+			n.pred.prepareRow(n.row, leftRow, rightRow)
+			return true, nil
+		}
+
+		next, err := n.probePlan.Next()
+		if err != nil {
+			return false, err
+		}
+		if !next {
+			return false, nil
+		}
+		n.probeRow = n.probePlan.Values()
+
+		key, containsNull, err := n.pred.encode(n.scratch[:0], n.probeRow, n.probeSide)
+		if err != nil {
+			return false, err
+		}
+		if containsNull {
+			n.scratch = key[:0]
+			n.probeMatches, n.probeCursor = nil, 0
+			continue
+		}
+		n.probeMatches, n.probeCursor = n.table[string(key)], 0
+		n.scratch = key[:0]
+	}
+}
+
+func (n *hashJoinNode) Values() parser.DTuple {
+	return n.row
+}
+
+func (n *hashJoinNode) Close() {
+	n.left.Close()
+	n.right.Close()
+	n.table = nil
+}
+
+func (n *hashJoinNode) Columns() ResultColumns {
+	return n.info.sourceColumns
+}
+
+// ExplainPlan implements the planNode interface, reporting "hash" so
+// that EXPLAIN can distinguish this strategy from the nested-loop join.
+func (n *hashJoinNode) ExplainPlan(v bool) (name, description string, children []planNode) {
+	var buf bytes.Buffer
+	buf.WriteString("hash")
+	n.pred.format(&buf)
+	return "join", buf.String(), []planNode{n.left, n.right}
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+func TestHashJoinPreferred(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		leftCount, rightCount int64
+		leftOK, rightOK       bool
+		want                  bool
+	}{
+		{"no estimates available", 0, 0, false, false, true},
+		{"only left estimate available", 5, 0, true, false, true},
+		{"both small", 5, 10, true, true, false},
+		{"both at threshold", minHashJoinRowCount, minHashJoinRowCount, true, true, true},
+		{"one side large", 5, 1000000, true, true, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := hashJoinPreferred(tc.leftCount, tc.leftOK, tc.rightCount, tc.rightOK)
+			if got != tc.want {
+				t.Errorf("hashJoinPreferred(%d, %v, %d, %v) = %v, want %v",
+					tc.leftCount, tc.leftOK, tc.rightCount, tc.rightOK, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRowByteSize(t *testing.T) {
+	row := parser.DTuple{parser.DInt(1), parser.DNull}
+	size, err := rowByteSize(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size <= 0 {
+		t.Errorf("expected a positive byte size, got %d", size)
+	}
+}
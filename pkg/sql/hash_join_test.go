@@ -0,0 +1,156 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// intEqFn is a minimal usingCmp comparator for DInt columns, standing
+// in for the real one parser.FindEqualComparisonFunction would return.
+func intEqFn(_ *parser.EvalContext, left, right parser.Datum) (parser.DBool, error) {
+	return parser.DBool(left.(parser.DInt) == right.(parser.DInt)), nil
+}
+
+// usingPred builds a single-column equalityPredicate over column 0 of
+// both inputs, the minimal shape hashJoinNode needs to exercise
+// buildTable/probe without going through makeUsingPredicate's column
+// bookkeeping.
+func usingPred(jType joinType) *equalityPredicate {
+	return &equalityPredicate{
+		leftColNames:      parser.NameList{parser.Name("x")},
+		rightColNames:     parser.NameList{parser.Name("x")},
+		usingCmp:          []func(*parser.EvalContext, parser.Datum, parser.Datum) (parser.DBool, error){intEqFn},
+		usingCollations:   []string{""},
+		leftUsingIndices:  []int{0},
+		rightUsingIndices: []int{0},
+		evalCtx:           &parser.EvalContext{},
+		joinType:          jType,
+	}
+}
+
+// TestHashJoinNodeBuildTableExcludesNullKeys checks that buildTable
+// never inserts a row whose equality-column key contains a NULL: NULL
+// never matches, not even another NULL, so such rows could never be
+// found by a probe anyway.
+func TestHashJoinNodeBuildTableExcludesNullKeys(t *testing.T) {
+	right := &fakeValuesNode{
+		cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}, {Name: "y", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{
+			{parser.DNull, parser.DInt(900)},
+			{parser.DInt(5), parser.DInt(500)},
+		},
+	}
+	left := &fakeValuesNode{
+		cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}, {Name: "z", Typ: parser.TypeInt}},
+	}
+	n := &hashJoinNode{left: left, right: right, pred: usingPred(joinInner), info: &dataSourceInfo{
+		sourceColumns: append(append(ResultColumns{}, left.cols...), right.cols...),
+	}}
+	if err := n.expandPlan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := right.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.buildTable(); err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	for _, rows := range n.table {
+		total += len(rows)
+	}
+	if total != 1 {
+		t.Fatalf("expected exactly 1 row in the hash table (the NULL-key row excluded), got %d", total)
+	}
+}
+
+// TestHashJoinNodeBuildTableMemoryLimit checks that buildTable errors
+// out once the accumulated row size exceeds maxHashJoinMemUsage,
+// rather than silently growing the table without bound.
+func TestHashJoinNodeBuildTableMemoryLimit(t *testing.T) {
+	huge := parser.DString(strings.Repeat("x", maxHashJoinMemUsage+1))
+	right := &fakeValuesNode{
+		cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}, {Name: "y", Typ: parser.TypeString}},
+		rows: []parser.DTuple{
+			{parser.DInt(1), huge},
+		},
+	}
+	left := &fakeValuesNode{cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}}}
+	n := &hashJoinNode{left: left, right: right, pred: usingPred(joinInner), info: &dataSourceInfo{
+		sourceColumns: append(append(ResultColumns{}, left.cols...), right.cols...),
+	}}
+	if err := n.expandPlan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := right.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.buildTable(); err == nil {
+		t.Fatal("expected buildTable to report the memory limit being exceeded, got nil")
+	}
+}
+
+// TestMakeHashJoinNodeRejectsOuterJoin checks that makeHashJoinNode
+// never picks the hash strategy for an outer join: hashJoinNode has no
+// matched-row bookkeeping for unmatched rows, only joinNode does.
+func TestMakeHashJoinNodeRejectsOuterJoin(t *testing.T) {
+	p := &planner{}
+	left := &fakeValuesNode{cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}}}
+	right := &fakeValuesNode{cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}}}
+	info := &dataSourceInfo{sourceColumns: append(append(ResultColumns{}, left.cols...), right.cols...)}
+
+	if _, ok := p.makeHashJoinNode(left, right, usingPred(joinLeftOuter), info); ok {
+		t.Fatal("expected makeHashJoinNode to reject a LEFT OUTER JOIN predicate")
+	}
+}
+
+// TestMakeHashJoinNodeOnPredicateEquijoin checks that makeHashJoinNode
+// accepts an onPredicate whose ON filter decomposes into an equijoin
+// conjunct (left.x = right.x), and that the resulting hashJoinNode
+// produces the correct matches end-to-end.
+func TestMakeHashJoinNodeOnPredicateEquijoin(t *testing.T) {
+	p := &planner{}
+	left := &fakeValuesNode{
+		cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{{parser.DInt(1)}, {parser.DInt(2)}},
+	}
+	right := &fakeValuesNode{
+		cols: ResultColumns{{Name: "x", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{{parser.DInt(2)}, {parser.DInt(3)}},
+	}
+	info := &dataSourceInfo{sourceColumns: append(append(ResultColumns{}, left.cols...), right.cols...)}
+
+	filter := &parser.ComparisonExpr{
+		Operator: parser.EQ,
+		Left:     &parser.IndexedVar{Idx: 0},
+		Right:    &parser.IndexedVar{Idx: 1},
+	}
+	pred := &onPredicate{p: p, info: info, numLeftCols: 1, joinType: joinInner, filter: filter}
+
+	node, ok := p.makeHashJoinNode(left, right, pred, info)
+	if !ok {
+		t.Fatal("expected makeHashJoinNode to accept an ON filter with an equijoin conjunct")
+	}
+
+	got := runJoin(t, node)
+	want := []parser.DTuple{{parser.DInt(2), parser.DInt(2)}}
+	if len(got) != len(want) || got[0][0] != want[0][0] || got[0][1] != want[0][1] {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
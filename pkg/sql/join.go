@@ -0,0 +1,103 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// planDataSource encapsulates the info and the plan for a FROM clause
+// reference, whether that's a table, a subquery, or (as built up here)
+// the result of joining two other planDataSources together.
+type planDataSource struct {
+	info *dataSourceInfo
+	plan planNode
+}
+
+// makeJoin constructs the plan and column metadata for a JOIN between
+// left and right, given the join's AST join type keyword (e.g. "",
+// "CROSS", "LEFT", "RIGHT", "FULL") and its condition. This is the sole
+// place that chooses between the hash-join and nested-loop strategies
+// and that turns a *parser.JoinTableExpr's Natural/On/Using condition into the
+// matching joinPredicate.
+func (p *planner) makeJoin(
+	astJoinType string, left, right planDataSource, cond parser.JoinCond,
+) (planDataSource, error) {
+	jType, err := astJoinTypeToJoinType(astJoinType)
+	if err != nil {
+		return planDataSource{}, err
+	}
+
+	var pred joinPredicate
+	var info *dataSourceInfo
+	switch t := cond.(type) {
+	case *parser.OnJoinCond:
+		pred, info, err = p.makeOnPredicate(left.info, right.info, t.Expr, jType)
+	case *parser.UsingJoinCond:
+		pred, info, err = p.makeUsingPredicate(left.info, right.info, t.Cols, jType)
+	case parser.NaturalJoinCond:
+		pred, info, err = p.makeNaturalPredicate(left.info, right.info, jType)
+	case nil:
+		info, err = concatDataSourceInfos(left.info, right.info)
+		if err == nil {
+			pred = &crossPredicate{
+				leftNumCols:  len(left.info.sourceColumns),
+				rightNumCols: len(right.info.sourceColumns),
+			}
+		}
+	default:
+		return planDataSource{}, fmt.Errorf("unsupported JOIN condition %T", t)
+	}
+	if err != nil {
+		return planDataSource{}, err
+	}
+
+	if hashNode, ok := p.makeHashJoinNode(left.plan, right.plan, pred, info); ok {
+		return planDataSource{info: info, plan: hashNode}, nil
+	}
+
+	return planDataSource{
+		info: info,
+		plan: &joinNode{
+			p:        p,
+			left:     left.plan,
+			right:    right.plan,
+			pred:     pred,
+			info:     info,
+			joinType: jType,
+		},
+	}, nil
+}
+
+// astJoinTypeToJoinType maps the join type keyword carried by a parsed
+// *parser.JoinTableExpr (empty string for a plain/CROSS JOIN, or one of
+// "LEFT"/"RIGHT"/"FULL") to the joinType enum threaded through predicate
+// construction and the driving join node.
+func astJoinTypeToJoinType(astJoinType string) (joinType, error) {
+	switch astJoinType {
+	case "", "CROSS", "INNER":
+		return joinInner, nil
+	case "LEFT":
+		return joinLeftOuter, nil
+	case "RIGHT":
+		return joinRightOuter, nil
+	case "FULL":
+		return joinFullOuter, nil
+	default:
+		return joinInner, fmt.Errorf("unsupported JOIN type %q", astJoinType)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"bytes"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// joinNode evaluates a join using a nested-loop: every row of left is
+// compared against every row of right via pred.eval(). It is the
+// fallback strategy whenever a hashJoinNode cannot be built (see
+// makeHashJoinNode), and it is also the only strategy that currently
+// knows how to produce outer-join results.
+//
+// joinType determines which side's unmatched rows must still be
+// emitted, NULL-extended on the other side. That bookkeeping lives
+// here rather than on the joinPredicate implementations: the predicate
+// only needs to know how to COALESCE/NULL-extend a row given that one
+// side is absent (see equalityPredicate.prepareRow), not which rows
+// are unmatched in the first place.
+type joinNode struct {
+	p *planner
+
+	left  planNode
+	right planNode
+	pred  joinPredicate
+	info  *dataSourceInfo
+
+	joinType joinType
+
+	// rightRows and rightMatched are populated once, on the first call
+	// to Next(), by buffering the entire right input. This is required
+	// for RIGHT/FULL OUTER JOIN, which must know, after the left input
+	// is exhausted, which right rows were never matched.
+	rightRows    []parser.DTuple
+	rightMatched []bool
+	rightBuilt   bool
+
+	leftRow     parser.DTuple
+	leftMatched bool
+	rightCursor int
+
+	// emittingUnmatchedRight is set once the left input (and the
+	// per-left-row scan of the right input) is exhausted, and we still
+	// need to walk rightRows looking for rows that were never matched.
+	emittingUnmatchedRight bool
+	unmatchedRightCursor   int
+
+	row parser.DTuple
+}
+
+func (n *joinNode) expandPlan() error {
+	if err := n.left.expandPlan(); err != nil {
+		return err
+	}
+	if err := n.right.expandPlan(); err != nil {
+		return err
+	}
+	return n.pred.expand()
+}
+
+func (n *joinNode) Start() error {
+	if err := n.left.Start(); err != nil {
+		return err
+	}
+	if err := n.right.Start(); err != nil {
+		return err
+	}
+	return n.pred.start()
+}
+
+func (n *joinNode) buildRight() error {
+	for {
+		next, err := n.right.Next()
+		if err != nil {
+			return err
+		}
+		if !next {
+			break
+		}
+		n.rightRows = append(n.rightRows, append(parser.DTuple(nil), n.right.Values()...))
+	}
+	if n.joinType == joinRightOuter || n.joinType == joinFullOuter {
+		n.rightMatched = make([]bool, len(n.rightRows))
+	}
+	n.rightBuilt = true
+	return nil
+}
+
+func (n *joinNode) Next() (bool, error) {
+	if !n.rightBuilt {
+		if err := n.buildRight(); err != nil {
+			return false, err
+		}
+	}
+	if n.row == nil {
+		n.row = make(parser.DTuple, len(n.Columns()))
+	}
+
+	for {
+		if n.emittingUnmatchedRight {
+			for n.unmatchedRightCursor < len(n.rightRows) {
+				idx := n.unmatchedRightCursor
+				n.unmatchedRightCursor++
+				if n.rightMatched[idx] {
+					continue
+				}
+				n.pred.prepareRow(n.row, nil, n.rightRows[idx])
+				return true, nil
+			}
+			return false, nil
+		}
+
+		if n.leftRow == nil {
+			next, err := n.left.Next()
+			if err != nil {
+				return false, err
+			}
+			if !next {
+				if n.joinType == joinRightOuter || n.joinType == joinFullOuter {
+					n.emittingUnmatchedRight = true
+					continue
+				}
+				return false, nil
+			}
+			n.leftRow = append(parser.DTuple(nil), n.left.Values()...)
+			n.leftMatched = false
+			n.rightCursor = 0
+		}
+
+		matched := false
+		for n.rightCursor < len(n.rightRows) {
+			rightRow := n.rightRows[n.rightCursor]
+			idx := n.rightCursor
+			n.rightCursor++
+
+			ok, err := n.pred.eval(n.row, n.leftRow, rightRow)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				continue
+			}
+			n.leftMatched = true
+			if n.rightMatched != nil {
+				n.rightMatched[idx] = true
+			}
+			n.pred.prepareRow(n.row, n.leftRow, rightRow)
+			matched = true
+			break
+		}
+		if matched {
+			return true, nil
+		}
+
+		// The right input is exhausted for this left row.
+		unmatched := !n.leftMatched && (n.joinType == joinLeftOuter || n.joinType == joinFullOuter)
+		leftRow := n.leftRow
+		n.leftRow = nil
+		if unmatched {
+			n.pred.prepareRow(n.row, leftRow, nil)
+			return true, nil
+		}
+	}
+}
+
+func (n *joinNode) Values() parser.DTuple {
+	return n.row
+}
+
+func (n *joinNode) Close() {
+	n.left.Close()
+	n.right.Close()
+	n.rightRows = nil
+	n.rightMatched = nil
+}
+
+func (n *joinNode) Columns() ResultColumns {
+	return n.info.sourceColumns
+}
+
+// ExplainPlan implements the planNode interface.
+func (n *joinNode) ExplainPlan(v bool) (name, description string, children []planNode) {
+	var buf bytes.Buffer
+	n.pred.format(&buf)
+	return "join", buf.String(), []planNode{n.left, n.right}
+}
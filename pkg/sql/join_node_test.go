@@ -0,0 +1,52 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// TestPrepareRowConcatNullExtension exercises the outer-join
+// unmatched-row path shared by crossPredicate and onPredicate: when one
+// side's row is absent (nil), its columns must come back as DNULL
+// rather than stale data or a misaligned copy.
+func TestPrepareRowConcatNullExtension(t *testing.T) {
+	leftRow := parser.DTuple{parser.DInt(1), parser.DInt(2)}
+	rightRow := parser.DTuple{parser.DInt(9)}
+
+	t.Run("right side absent", func(t *testing.T) {
+		result := parser.DTuple{parser.DInt(100), parser.DInt(100), parser.DInt(100)}
+		prepareRowConcat(result, leftRow, nil, 2, 1)
+		if result[0] != leftRow[0] || result[1] != leftRow[1] {
+			t.Errorf("left columns = %v, want %v", result[:2], leftRow)
+		}
+		if result[2] != parser.DNull {
+			t.Errorf("right column = %v, want DNull", result[2])
+		}
+	})
+
+	t.Run("left side absent", func(t *testing.T) {
+		result := parser.DTuple{parser.DInt(100), parser.DInt(100), parser.DInt(100)}
+		prepareRowConcat(result, nil, rightRow, 2, 1)
+		if result[0] != parser.DNull || result[1] != parser.DNull {
+			t.Errorf("left columns = %v, want DNull, DNull", result[:2])
+		}
+		if result[2] != rightRow[0] {
+			t.Errorf("right column = %v, want %v", result[2], rightRow[0])
+		}
+	})
+}
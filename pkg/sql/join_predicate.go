@@ -60,21 +60,42 @@ var _ joinPredicate = &equalityPredicate{}
 
 // prepareRowConcat implement the simple case of CROSS JOIN or JOIN
 // with an ON clause, where the rows of the two inputs are simply
-// concatenated.
-func prepareRowConcat(result parser.DTuple, leftRow parser.DTuple, rightRow parser.DTuple) {
-	copy(result, leftRow)
-	copy(result[len(leftRow):], rightRow)
+// concatenated. leftNumCols/rightNumCols give the width of each side's
+// contribution to result; for an outer join's unmatched rows, the
+// driving join node signals an absent side by passing leftRow or
+// rightRow as nil, in which case that side's slots are NULL-extended
+// rather than left holding whatever was last written to result.
+func prepareRowConcat(
+	result, leftRow, rightRow parser.DTuple, leftNumCols, rightNumCols int,
+) {
+	if leftRow == nil {
+		for i := 0; i < leftNumCols; i++ {
+			result[i] = parser.DNull
+		}
+	} else {
+		copy(result, leftRow)
+	}
+	if rightRow == nil {
+		for i := 0; i < rightNumCols; i++ {
+			result[leftNumCols+i] = parser.DNull
+		}
+	} else {
+		copy(result[leftNumCols:], rightRow)
+	}
 }
 
 // crossPredicate implements the predicate logic for CROSS JOIN. The
 // predicate is always true, the work done here is thus minimal.
-type crossPredicate struct{}
+type crossPredicate struct {
+	leftNumCols  int
+	rightNumCols int
+}
 
 func (p *crossPredicate) eval(_, _, _ parser.DTuple) (bool, error) {
 	return true, nil
 }
 func (p *crossPredicate) prepareRow(result, leftRow, rightRow parser.DTuple) {
-	prepareRowConcat(result, leftRow, rightRow)
+	prepareRowConcat(result, leftRow, rightRow, p.leftNumCols, p.rightNumCols)
 }
 func (p *crossPredicate) start() error                        { return nil }
 func (p *crossPredicate) expand() error                       { return nil }
@@ -91,6 +112,23 @@ type onPredicate struct {
 	info   *dataSourceInfo
 	curRow parser.DTuple
 
+	// numLeftCols is the number of columns contributed by the left
+	// input, used to classify the equijoin conjuncts extracted below as
+	// referencing the left or the right side.
+	numLeftCols int
+
+	// eqConjuncts holds the column pairs extracted from filter that
+	// compare a left column to a right column with equality. It is
+	// populated once, lazily, by equalityConjuncts. A nil slice means
+	// extraction has not been attempted yet; an empty non-nil slice
+	// means the filter could not be decomposed into any such conjuncts.
+	eqConjuncts []onPredicateEqConjunct
+
+	// joinType is carried only so format() can describe the join for
+	// EXPLAIN; NULL-extension of unmatched rows is handled by the join
+	// plan node, not here.
+	joinType joinType
+
 	// This struct must be allocated on the heap and its location stay
 	// stable after construction because it implements
 	// IndexedVarContainer and the IndexedVar objects in sub-expressions
@@ -99,6 +137,13 @@ type onPredicate struct {
 	noCopy util.NoCopy
 }
 
+// onPredicateEqConjunct records one `left.col = right.col` conjunct
+// extracted from an ON filter, as row-local column indices.
+type onPredicateEqConjunct struct {
+	leftIdx  int
+	rightIdx int
+}
+
 // IndexedVarEval implements the parser.IndexedVarContainer interface.
 func (p *onPredicate) IndexedVarEval(idx int, ctx *parser.EvalContext) (parser.Datum, error) {
 	return p.curRow[idx].Eval(ctx)
@@ -114,20 +159,92 @@ func (p *onPredicate) IndexedVarFormat(buf *bytes.Buffer, f parser.FmtFlags, idx
 	p.info.FormatVar(buf, f, idx)
 }
 
-func (p *onPredicate) encode(_ []byte, _ parser.DTuple, _ int) ([]byte, bool, error) {
-	panic("ON predicate extraction unimplemented")
+// encode implements joinPredicate.encode by reducing the ON filter to
+// its equijoin conjuncts (see equalityConjuncts) and encoding those
+// columns, the same way equalityPredicate.encode does for USING. This
+// lets a hash join consume an ON clause whenever it decomposes into a
+// conjunction that includes at least one `left.col = right.col` term;
+// any remaining conjuncts are still checked by eval() as a residual
+// filter once rows have been probed into the hash table.
+func (p *onPredicate) encode(b []byte, row parser.DTuple, side int) ([]byte, bool, error) {
+	conjuncts, err := p.equalityConjuncts()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(conjuncts) == 0 {
+		return nil, false, fmt.Errorf("ON predicate cannot be decomposed into an equijoin")
+	}
+
+	containsNull := false
+	for _, c := range conjuncts {
+		idx := c.leftIdx
+		if side == rightSide {
+			idx = c.rightIdx
+		} else if side != leftSide {
+			panic("invalid side provided, only leftSide or rightSide applicable")
+		}
+		if row[idx] == parser.DNull {
+			containsNull = true
+		}
+		b, err = sqlbase.EncodeDatum(b, row[idx])
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return b, containsNull, nil
+}
+
+// equalityConjuncts extracts, from the top-level AND conjuncts of the
+// ON filter, those of the form `left.col = right.col` (a bare column
+// reference on each side of an equality comparison, one from the left
+// input and one from the right input). The result is memoized on p.
+func (p *onPredicate) equalityConjuncts() ([]onPredicateEqConjunct, error) {
+	if p.eqConjuncts != nil {
+		return p.eqConjuncts, nil
+	}
+	conjuncts := make([]onPredicateEqConjunct, 0)
+	for _, e := range splitAndConjuncts(p.filter) {
+		cmp, ok := e.(*parser.ComparisonExpr)
+		if !ok || cmp.Operator != parser.EQ {
+			continue
+		}
+		lv, lok := cmp.TypedLeft().(*parser.IndexedVar)
+		rv, rok := cmp.TypedRight().(*parser.IndexedVar)
+		if !lok || !rok {
+			continue
+		}
+		switch {
+		case lv.Idx < p.numLeftCols && rv.Idx >= p.numLeftCols:
+			conjuncts = append(conjuncts, onPredicateEqConjunct{leftIdx: lv.Idx, rightIdx: rv.Idx - p.numLeftCols})
+		case rv.Idx < p.numLeftCols && lv.Idx >= p.numLeftCols:
+			conjuncts = append(conjuncts, onPredicateEqConjunct{leftIdx: rv.Idx, rightIdx: lv.Idx - p.numLeftCols})
+		}
+	}
+	p.eqConjuncts = conjuncts
+	return p.eqConjuncts, nil
+}
+
+// splitAndConjuncts flattens the top-level AND expressions of e into
+// its individual conjuncts, e.g. `a AND b AND c` becomes [a, b, c]. A
+// filter with no top-level AND is returned as a single-element slice.
+func splitAndConjuncts(e parser.TypedExpr) []parser.TypedExpr {
+	and, ok := e.(*parser.AndExpr)
+	if !ok {
+		return []parser.TypedExpr{e}
+	}
+	return append(splitAndConjuncts(and.TypedLeft()), splitAndConjuncts(and.TypedRight())...)
 }
 
 // eval for onPredicate uses an arbitrary SQL expression to determine
 // whether the left and right input row can join.
 func (p *onPredicate) eval(result, leftRow, rightRow parser.DTuple) (bool, error) {
 	p.curRow = result
-	prepareRowConcat(p.curRow, leftRow, rightRow)
+	prepareRowConcat(p.curRow, leftRow, rightRow, p.numLeftCols, len(p.info.sourceColumns)-p.numLeftCols)
 	return sqlbase.RunFilter(p.filter, &p.p.evalCtx)
 }
 
 func (p *onPredicate) prepareRow(result, leftRow, rightRow parser.DTuple) {
-	prepareRowConcat(result, leftRow, rightRow)
+	prepareRowConcat(result, leftRow, rightRow, p.numLeftCols, len(p.info.sourceColumns)-p.numLeftCols)
 }
 
 func (p *onPredicate) expand() error {
@@ -139,6 +256,10 @@ func (p *onPredicate) start() error {
 }
 
 func (p *onPredicate) format(buf *bytes.Buffer) {
+	if s := p.joinType.describe(); s != "" {
+		buf.WriteString(" ")
+		buf.WriteString(s)
+	}
 	buf.WriteString(" ON ")
 	p.filter.Format(buf, parser.FmtQualify)
 }
@@ -150,9 +271,12 @@ func (p *onPredicate) explainTypes(regTypes func(string, string)) {
 }
 
 // makeOnPredicate constructs a joinPredicate object for joins with a
-// ON clause.
+// ON clause. jType records the join's outer-join variant, if any, so
+// that it can be reported by format(); the join plan node, not this
+// predicate, is responsible for actually producing NULL-extended rows
+// for unmatched input.
 func (p *planner) makeOnPredicate(
-	left, right *dataSourceInfo, expr parser.Expr,
+	left, right *dataSourceInfo, expr parser.Expr, jType joinType,
 ) (joinPredicate, *dataSourceInfo, error) {
 	// Output rows are the concatenation of input rows.
 	info, err := concatDataSourceInfos(left, right)
@@ -161,8 +285,10 @@ func (p *planner) makeOnPredicate(
 	}
 
 	pred := &onPredicate{
-		p:    p,
-		info: info,
+		p:           p,
+		info:        info,
+		numLeftCols: len(left.sourceColumns),
+		joinType:    jType,
 	}
 
 	// Determine the filter expression.
@@ -191,6 +317,13 @@ type equalityPredicate struct {
 	// evalCtx is needed to evaluate the functions in usingCmp.
 	evalCtx *parser.EvalContext
 
+	// usingCollations[i] holds the resolved collation locale for USING
+	// column i when usingCmp[i] is collation-parameterized (see
+	// resolveUsingCollation), or "" otherwise. encode() consults this
+	// to hash on the same collation key eval() compares by, rather than
+	// the raw (collation-oblivious) datum encoding.
+	usingCollations []string
+
 	// left/rightUsingIndices give the position of USING columns
 	// on the left and right input row arrays, respectively.
 	leftUsingIndices  []int
@@ -200,9 +333,27 @@ type equalityPredicate struct {
 	// the left and right input row arrays, respectively.
 	leftRestIndices  []int
 	rightRestIndices []int
+
+	// natural is set when this predicate was derived from a NATURAL
+	// JOIN rather than an explicit USING clause, so that EXPLAIN can
+	// report the original syntax instead of the derived column list.
+	natural bool
+
+	// joinType is carried only so format() can describe the join for
+	// EXPLAIN; NULL-extension of unmatched rows is handled by the join
+	// plan node, not here.
+	joinType joinType
 }
 
 func (p *equalityPredicate) format(buf *bytes.Buffer) {
+	if s := p.joinType.describe(); s != "" {
+		buf.WriteString(" ")
+		buf.WriteString(s)
+	}
+	if p.natural {
+		buf.WriteString(" NATURAL JOIN")
+		return
+	}
 	buf.WriteString(" ON EQUALS((")
 	p.leftColNames.Format(buf, parser.FmtSimple)
 	buf.WriteString("),(")
@@ -240,23 +391,41 @@ func (p *equalityPredicate) eval(_, leftRow, rightRow parser.DTuple) (bool, erro
 // clauses and CROSS JOIN: a result row contains first the values for
 // the USING columns; then the non-USING values from the left input
 // row, then the non-USING values from the right input row.
+//
+// For outer joins, the driving join node passes a nil leftRow or
+// rightRow to signal that the corresponding side has no match for this
+// result row; its contribution, USING or not, is then taken to be
+// DNULL, same as for any other unmatched column.
 func (p *equalityPredicate) prepareRow(result, leftRow, rightRow parser.DTuple) {
 	d := 0
 	for k, j := range p.leftUsingIndices {
-		// The result for USING columns must be computed as per COALESCE().
-		if leftRow[j] != parser.DNull {
+		switch {
+		case leftRow == nil:
+			result[d] = rightRow[p.rightUsingIndices[k]]
+		case rightRow == nil:
 			result[d] = leftRow[j]
-		} else {
+		case leftRow[j] != parser.DNull:
+			// The result for USING columns must be computed as per COALESCE().
+			result[d] = leftRow[j]
+		default:
 			result[d] = rightRow[p.rightUsingIndices[k]]
 		}
 		d++
 	}
 	for _, j := range p.leftRestIndices {
-		result[d] = leftRow[j]
+		if leftRow == nil {
+			result[d] = parser.DNull
+		} else {
+			result[d] = leftRow[j]
+		}
 		d++
 	}
 	for _, j := range p.rightRestIndices {
-		result[d] = rightRow[j]
+		if rightRow == nil {
+			result[d] = parser.DNull
+		} else {
+			result[d] = rightRow[j]
+		}
 		d++
 	}
 }
@@ -274,11 +443,29 @@ func (p *equalityPredicate) encode(b []byte, row parser.DTuple, side int) ([]byt
 
 	var err error
 	containsNull := false
-	for _, colIdx := range cols {
-		if row[colIdx] == parser.DNull {
+	for i, colIdx := range cols {
+		d := row[colIdx]
+		if d == parser.DNull {
 			containsNull = true
+			b, err = sqlbase.EncodeDatum(b, d)
+			if err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		if locale := p.usingCollations[i]; locale != "" {
+			// Hash on the same collation key eval()/usingCmp[i] compare
+			// by, not the raw datum encoding, so that a collated string
+			// and a plain string considered equal under the resolved
+			// collation land in the same bucket (see resolveUsingCollation).
+			key, kerr := collationKey(p.evalCtx, d, locale)
+			if kerr != nil {
+				return nil, false, kerr
+			}
+			b = append(b, key...)
+			continue
 		}
-		b, err = sqlbase.EncodeDatum(b, row[colIdx])
+		b, err = sqlbase.EncodeDatum(b, d)
 		if err != nil {
 			return nil, false, err
 		}
@@ -286,6 +473,66 @@ func (p *equalityPredicate) encode(b []byte, row parser.DTuple, side int) ([]byt
 	return b, containsNull, nil
 }
 
+// makeNaturalPredicate constructs a joinPredicate object for NATURAL
+// JOIN. The USING column list is derived automatically as the
+// intersection of the non-hidden column names of the left and right
+// data sources, in the order they appear on the left side. If that
+// intersection is empty, a NATURAL JOIN is equivalent to a CROSS JOIN
+// and no equality predicate is necessary.
+func (p *planner) makeNaturalPredicate(
+	left *dataSourceInfo, right *dataSourceInfo, jType joinType,
+) (joinPredicate, *dataSourceInfo, error) {
+	colNames := commonColumns(left, right)
+	if len(colNames) == 0 {
+		info, err := concatDataSourceInfos(left, right)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &crossPredicate{
+			leftNumCols:  len(left.sourceColumns),
+			rightNumCols: len(right.sourceColumns),
+		}, info, nil
+	}
+
+	pred, info, err := p.makeEqualityPredicate(left, right, colNames, colNames, jType)
+	if err != nil {
+		return nil, nil, err
+	}
+	pred.(*equalityPredicate).natural = true
+	return pred, info, nil
+}
+
+// commonColumns returns the list of non-hidden column names shared by
+// both sides of a NATURAL JOIN, normalized the same way pickUsingColumn
+// normalizes USING column names. The result preserves the order in
+// which the columns appear on the left side and contains no duplicates.
+func commonColumns(left, right *dataSourceInfo) parser.NameList {
+	rightNames := make(map[string]struct{}, len(right.sourceColumns))
+	for _, col := range right.sourceColumns {
+		if col.hidden {
+			continue
+		}
+		rightNames[parser.ReNormalizeName(col.Name)] = struct{}{}
+	}
+
+	var colNames parser.NameList
+	seen := make(map[string]struct{})
+	for _, col := range left.sourceColumns {
+		if col.hidden {
+			continue
+		}
+		name := parser.ReNormalizeName(col.Name)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		if _, ok := rightNames[name]; ok {
+			seen[name] = struct{}{}
+			colNames = append(colNames, parser.Name(name))
+		}
+	}
+	return colNames
+}
+
 // pickUsingColumn searches for a column whose name matches colName.
 // The column index and type are returned if found, otherwise an error
 // is reported.
@@ -308,7 +555,7 @@ func pickUsingColumn(cols ResultColumns, colName string, context string) (int, p
 // makeUsingPredicate constructs a joinPredicate object for joins with
 // a USING clause.
 func (p *planner) makeUsingPredicate(
-	left *dataSourceInfo, right *dataSourceInfo, colNames parser.NameList,
+	left *dataSourceInfo, right *dataSourceInfo, colNames parser.NameList, jType joinType,
 ) (joinPredicate, *dataSourceInfo, error) {
 	seenNames := make(map[string]struct{})
 
@@ -320,7 +567,7 @@ func (p *planner) makeUsingPredicate(
 		}
 		seenNames[colName] = struct{}{}
 	}
-	return p.makeEqualityPredicate(left, right, colNames, colNames)
+	return p.makeEqualityPredicate(left, right, colNames, colNames, jType)
 }
 
 // makeEqualityPredicate constructs a joinPredicate object for joins.
@@ -329,12 +576,14 @@ func (p *planner) makeEqualityPredicate(
 	right *dataSourceInfo,
 	leftColNames parser.NameList,
 	rightColNames parser.NameList,
+	jType joinType,
 ) (joinPredicate, *dataSourceInfo, error) {
 	if len(leftColNames) != len(rightColNames) {
 		panic(fmt.Errorf("left columns' length %q doesn't match right columns' length %q in EqualityPredicate",
 			len(leftColNames), len(rightColNames)))
 	}
 	cmpOps := make([]func(*parser.EvalContext, parser.Datum, parser.Datum) (parser.DBool, error), len(leftColNames))
+	usingCollations := make([]string, len(leftColNames))
 	leftUsingIndices := make([]int, len(leftColNames))
 	rightUsingIndices := make([]int, len(rightColNames))
 	usedLeft := make([]int, len(left.sourceColumns))
@@ -370,16 +619,35 @@ func (p *planner) makeEqualityPredicate(
 		leftUsingIndices[i] = leftIdx
 		rightUsingIndices[i] = rightIdx
 
-		// Memoize the comparison function.
-		fn, found := parser.FindEqualComparisonFunction(leftType, rightType)
-		if !found {
-			return nil, nil, fmt.Errorf("JOIN/USING types %s for left column %s and %s for right column %s cannot be matched",
-				leftType, leftColName, rightType, rightColName)
+		// Memoize the comparison function. A plain type-based lookup
+		// would compare collated strings byte-for-byte and ignore their
+		// declared collation, so resolve a shared collation first (if
+		// the USING column is string-typed on either side) and install
+		// a comparator parameterized on it instead.
+		outputTyp := leftType
+		locale, collated, err := resolveUsingCollation(leftType, rightType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("JOIN/USING column %q: %v", leftColName, err)
+		}
+		if collated {
+			cmpOps[i] = makeCollatedStringEqFn(locale)
+			usingCollations[i] = locale
+			outputTyp = parser.TCollatedString{Locale: locale}
+		} else {
+			fn, found := parser.FindEqualComparisonFunction(leftType, rightType)
+			if !found {
+				return nil, nil, fmt.Errorf("JOIN/USING types %s for left column %s and %s for right column %s cannot be matched",
+					leftType, leftColName, rightType, rightColName)
+			}
+			cmpOps[i] = fn
 		}
-		cmpOps[i] = fn
 
-		// Prepare the output column for EqualityPredicate.
-		columns = append(columns, left.sourceColumns[leftIdx])
+		// Prepare the output column for EqualityPredicate. Downstream
+		// operators (GROUP BY, ORDER BY) on the USING column inherit the
+		// resolved collation from here.
+		outCol := left.sourceColumns[leftIdx]
+		outCol.Typ = outputTyp
+		columns = append(columns, outCol)
 	}
 
 	// Find out which columns are not involved in the EqualityPredicate.
@@ -428,9 +696,93 @@ func (p *planner) makeEqualityPredicate(
 		leftColNames:      leftColNames,
 		rightColNames:     rightColNames,
 		usingCmp:          cmpOps,
+		usingCollations:   usingCollations,
 		leftUsingIndices:  leftUsingIndices,
 		rightUsingIndices: rightUsingIndices,
 		leftRestIndices:   leftRestIndices,
 		rightRestIndices:  rightRestIndices,
+		joinType:          jType,
 	}, info, nil
 }
+
+// resolveUsingCollation determines the collation a USING column
+// comparison must use, given the declared types of its left and right
+// columns. collated is false (and locale is meaningless) when neither
+// side is a collated string, in which case the caller should fall back
+// to the ordinary type-based comparator.
+//
+// Coercibility follows the usual SQL rule: an explicit collation (a
+// declared TCollatedString) beats an implicit one (a plain STRING,
+// which has no locale of its own). Two explicit collations that
+// disagree are a conflict, since neither can be preferred over the
+// other. A single-sided explicit collation is only coercible against a
+// plain STRING on the other side; matched against any other type, that
+// is a plain type mismatch and must be reported as such here rather
+// than left to surface as a confusing error at execution time.
+func resolveUsingCollation(leftType, rightType parser.Type) (locale string, collated bool, err error) {
+	leftColl, leftExplicit := leftType.(parser.TCollatedString)
+	rightColl, rightExplicit := rightType.(parser.TCollatedString)
+
+	switch {
+	case leftExplicit && rightExplicit:
+		if leftColl.Locale != rightColl.Locale {
+			return "", false, fmt.Errorf("conflicting collations %q and %q", leftColl.Locale, rightColl.Locale)
+		}
+		return leftColl.Locale, true, nil
+	case leftExplicit:
+		if rightType != parser.TypeString {
+			return "", false, fmt.Errorf("type %s for right column cannot be matched against collated type %s for left column", rightType, leftType)
+		}
+		return leftColl.Locale, true, nil
+	case rightExplicit:
+		if leftType != parser.TypeString {
+			return "", false, fmt.Errorf("type %s for left column cannot be matched against collated type %s for right column", leftType, rightType)
+		}
+		return rightColl.Locale, true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// makeCollatedStringEqFn returns a comparator for usingCmp that
+// normalizes both operands to locale before comparing them, so that a
+// collated string matched against a plain STRING operand (see
+// resolveUsingCollation) compares according to the resolved collation
+// rather than by raw bytes.
+func makeCollatedStringEqFn(
+	locale string,
+) func(*parser.EvalContext, parser.Datum, parser.Datum) (parser.DBool, error) {
+	return func(ctx *parser.EvalContext, left, right parser.Datum) (parser.DBool, error) {
+		lKey, err := collationKey(ctx, left, locale)
+		if err != nil {
+			return false, err
+		}
+		rKey, err := collationKey(ctx, right, locale)
+		if err != nil {
+			return false, err
+		}
+		return parser.DBool(bytes.Equal(lKey, rKey)), nil
+	}
+}
+
+// collationKey returns the collation key of d under locale, keying it
+// first if d is a plain string or was declared under another collation.
+func collationKey(ctx *parser.EvalContext, d parser.Datum, locale string) ([]byte, error) {
+	var contents string
+	switch t := d.(type) {
+	case *parser.DCollatedString:
+		if t.Locale == locale {
+			return t.Key, nil
+		}
+		contents = t.Contents
+	case *parser.DString:
+		contents = string(*t)
+	default:
+		return nil, fmt.Errorf("expected a string, got %s", d.ResolvedType())
+	}
+	reKeyed, err := parser.NewDCollatedString(contents, locale, &ctx.CollationEnv)
+	if err != nil {
+		return nil, err
+	}
+	return reKeyed.Key, nil
+}
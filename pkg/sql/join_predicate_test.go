@@ -0,0 +1,123 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+func namesOf(names parser.NameList) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = string(n)
+	}
+	return out
+}
+
+// TestMakeNaturalPredicateColumnOrdering verifies that the USING column
+// list NATURAL JOIN derives preserves left-side ordering and skips
+// hidden columns and columns absent from the other side.
+func TestMakeNaturalPredicateColumnOrdering(t *testing.T) {
+	p := &planner{}
+	left := &dataSourceInfo{sourceColumns: ResultColumns{
+		{Name: "a", Typ: parser.TypeInt},
+		{Name: "b", Typ: parser.TypeInt},
+		{Name: "rowid", Typ: parser.TypeInt, hidden: true},
+	}}
+	right := &dataSourceInfo{sourceColumns: ResultColumns{
+		{Name: "b", Typ: parser.TypeInt},
+		{Name: "a", Typ: parser.TypeInt},
+		{Name: "c", Typ: parser.TypeInt},
+	}}
+
+	pred, _, err := p.makeNaturalPredicate(left, right, joinInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eq, ok := pred.(*equalityPredicate)
+	if !ok {
+		t.Fatalf("expected *equalityPredicate, got %T", pred)
+	}
+	want := []string{"a", "b"}
+	if got := namesOf(eq.leftColNames); !reflect.DeepEqual(got, want) {
+		t.Errorf("leftColNames = %v, want %v", got, want)
+	}
+	if got := namesOf(eq.rightColNames); !reflect.DeepEqual(got, want) {
+		t.Errorf("rightColNames = %v, want %v", got, want)
+	}
+}
+
+// TestMakeNaturalPredicateHiddenOnly checks that a hidden system column
+// shared by name on both sides is not treated as a common column.
+func TestMakeNaturalPredicateHiddenOnly(t *testing.T) {
+	p := &planner{}
+	left := &dataSourceInfo{sourceColumns: ResultColumns{
+		{Name: "rowid", Typ: parser.TypeInt, hidden: true},
+		{Name: "a", Typ: parser.TypeInt},
+	}}
+	right := &dataSourceInfo{sourceColumns: ResultColumns{
+		{Name: "rowid", Typ: parser.TypeInt, hidden: true},
+		{Name: "b", Typ: parser.TypeInt},
+	}}
+
+	pred, _, err := p.makeNaturalPredicate(left, right, joinInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pred.(*crossPredicate); !ok {
+		t.Fatalf("expected NATURAL JOIN with no shared non-hidden columns to degenerate to *crossPredicate, got %T", pred)
+	}
+}
+
+// TestMakeNaturalPredicateTypeMismatch checks that a NATURAL JOIN is
+// rejected when a shared column name has incompatible types on the two
+// sides.
+func TestMakeNaturalPredicateTypeMismatch(t *testing.T) {
+	p := &planner{}
+	left := &dataSourceInfo{sourceColumns: ResultColumns{
+		{Name: "a", Typ: parser.TypeBool},
+	}}
+	right := &dataSourceInfo{sourceColumns: ResultColumns{
+		{Name: "a", Typ: parser.TypeInterval},
+	}}
+
+	if _, _, err := p.makeNaturalPredicate(left, right, joinInner); err == nil {
+		t.Fatal("expected an error for columns with no equal comparison function, got nil")
+	}
+}
+
+// TestMakeNaturalPredicateDegenerateToCross checks that a NATURAL JOIN
+// with no common columns at all behaves like a CROSS JOIN rather than
+// erroring out.
+func TestMakeNaturalPredicateDegenerateToCross(t *testing.T) {
+	p := &planner{}
+	left := &dataSourceInfo{sourceColumns: ResultColumns{{Name: "a", Typ: parser.TypeInt}}}
+	right := &dataSourceInfo{sourceColumns: ResultColumns{{Name: "b", Typ: parser.TypeInt}}}
+
+	pred, _, err := p.makeNaturalPredicate(left, right, joinInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, ok := pred.(*crossPredicate)
+	if !ok {
+		t.Fatalf("expected *crossPredicate, got %T", pred)
+	}
+	if cp.leftNumCols != 1 || cp.rightNumCols != 1 {
+		t.Errorf("crossPredicate column counts = (%d, %d), want (1, 1)", cp.leftNumCols, cp.rightNumCols)
+	}
+}
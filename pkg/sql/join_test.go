@@ -0,0 +1,148 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// fakeValuesNode is a minimal planNode backed by a fixed set of rows,
+// used to drive makeJoin's output end-to-end in tests without a real
+// scanNode/valuesNode.
+type fakeValuesNode struct {
+	cols   ResultColumns
+	rows   []parser.DTuple
+	cursor int
+}
+
+func (f *fakeValuesNode) expandPlan() error { return nil }
+func (f *fakeValuesNode) Start() error      { f.cursor = -1; return nil }
+func (f *fakeValuesNode) Next() (bool, error) {
+	f.cursor++
+	return f.cursor < len(f.rows), nil
+}
+func (f *fakeValuesNode) Values() parser.DTuple  { return f.rows[f.cursor] }
+func (f *fakeValuesNode) Close()                 {}
+func (f *fakeValuesNode) Columns() ResultColumns { return f.cols }
+func (f *fakeValuesNode) ExplainPlan(_ bool) (name, description string, children []planNode) {
+	return "values", "", nil
+}
+
+func runJoin(t *testing.T, plan planNode) []parser.DTuple {
+	t.Helper()
+	if err := plan.expandPlan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var got []parser.DTuple
+	for {
+		next, err := plan.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !next {
+			break
+		}
+		got = append(got, append(parser.DTuple(nil), plan.Values()...))
+	}
+	return got
+}
+
+// TestMakeJoinNaturalUsesHashJoin runs an actual NATURAL JOIN through
+// makeJoin end-to-end: with no row-count estimates available from
+// either side, hashJoinPreferred defaults to the hash strategy, so this
+// also exercises makeHashJoinNode picking up the equijoin derived from
+// NATURAL JOIN's common column ("b").
+func TestMakeJoinNaturalUsesHashJoin(t *testing.T) {
+	p := &planner{}
+	left := &fakeValuesNode{
+		cols: ResultColumns{{Name: "a", Typ: parser.TypeInt}, {Name: "b", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{
+			{parser.DInt(1), parser.DInt(10)},
+			{parser.DInt(2), parser.DInt(20)},
+		},
+	}
+	right := &fakeValuesNode{
+		cols: ResultColumns{{Name: "b", Typ: parser.TypeInt}, {Name: "c", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{
+			{parser.DInt(10), parser.DInt(100)},
+			{parser.DInt(30), parser.DInt(300)},
+		},
+	}
+	leftSrc := planDataSource{info: &dataSourceInfo{sourceColumns: left.cols}, plan: left}
+	rightSrc := planDataSource{info: &dataSourceInfo{sourceColumns: right.cols}, plan: right}
+
+	out, err := p.makeJoin("", leftSrc, rightSrc, parser.NaturalJoinCond{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.plan.(*hashJoinNode); !ok {
+		t.Fatalf("expected NATURAL JOIN with no estimates to plan as *hashJoinNode, got %T", out.plan)
+	}
+
+	got := runJoin(t, out.plan)
+	want := []parser.DTuple{
+		{parser.DInt(10), parser.DInt(1), parser.DInt(100)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+// TestMakeJoinLeftOuterUsingFallsBackToJoinNode runs a LEFT OUTER JOIN
+// USING (b) through makeJoin end-to-end. makeHashJoinNode rejects
+// outer-join predicates, so this exercises the joinNode fallback and
+// its NULL-extension of unmatched left rows.
+func TestMakeJoinLeftOuterUsingFallsBackToJoinNode(t *testing.T) {
+	p := &planner{}
+	left := &fakeValuesNode{
+		cols: ResultColumns{{Name: "a", Typ: parser.TypeInt}, {Name: "b", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{
+			{parser.DInt(1), parser.DInt(10)},
+			{parser.DInt(2), parser.DInt(99)},
+		},
+	}
+	right := &fakeValuesNode{
+		cols: ResultColumns{{Name: "b", Typ: parser.TypeInt}, {Name: "c", Typ: parser.TypeInt}},
+		rows: []parser.DTuple{
+			{parser.DInt(10), parser.DInt(100)},
+		},
+	}
+	leftSrc := planDataSource{info: &dataSourceInfo{sourceColumns: left.cols}, plan: left}
+	rightSrc := planDataSource{info: &dataSourceInfo{sourceColumns: right.cols}, plan: right}
+
+	cond := &parser.UsingJoinCond{Cols: parser.NameList{parser.Name("b")}}
+	out, err := p.makeJoin("LEFT", leftSrc, rightSrc, cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.plan.(*joinNode); !ok {
+		t.Fatalf("expected LEFT OUTER JOIN to fall back to *joinNode, got %T", out.plan)
+	}
+
+	got := runJoin(t, out.plan)
+	want := []parser.DTuple{
+		{parser.DInt(10), parser.DInt(1), parser.DInt(100)},
+		{parser.DInt(99), parser.DInt(2), parser.DNull},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
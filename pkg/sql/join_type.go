@@ -0,0 +1,46 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+// joinType identifies which rows a join must preserve when they have
+// no match on the other side. It is carried on the join plan node,
+// which is responsible for emitting the NULL-extended rows; the
+// joinPredicate implementations only need it to describe themselves
+// for EXPLAIN, so that the predicate interface itself stays oblivious
+// to join direction.
+type joinType int
+
+const (
+	joinInner joinType = iota
+	joinLeftOuter
+	joinRightOuter
+	joinFullOuter
+)
+
+// describe returns the EXPLAIN keyword for the join type, or the empty
+// string for an inner join (which adds no qualifier to the predicate's
+// own description).
+func (t joinType) describe() string {
+	switch t {
+	case joinLeftOuter:
+		return "LEFT OUTER JOIN"
+	case joinRightOuter:
+		return "RIGHT OUTER JOIN"
+	case joinFullOuter:
+		return "FULL OUTER JOIN"
+	default:
+		return ""
+	}
+}